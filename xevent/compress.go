@@ -0,0 +1,84 @@
+package xevent
+
+/*
+xevent/compress.go generalizes the MotionNotify coalescing trick that used
+to be hard-coded in processEventQueue into a pluggable registry. Interactive
+resize can produce a ConfigureNotify storm just as easily as mouse movement
+produces a MotionNotify storm, and repaint can produce an Expose burst, so
+there's no reason compression should be special-cased to motion events.
+*/
+
+import (
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+
+	"github.com/BurntSushi/xgbutil"
+)
+
+// Compressor merges runs of same-shaped events together, so a burst of
+// e.g. ConfigureNotify or Expose events doesn't get processed one at a
+// time.
+type Compressor interface {
+	// Match reports whether 'next' continues the same run as 'prev' --
+	// e.g. they're both ConfigureNotify events for the same window.
+	Match(prev, next xgb.Event) bool
+
+	// Merge combines 'prev' and 'next' into the event that should replace
+	// both of them in the queue.
+	Merge(prev, next xgb.Event) xgb.Event
+}
+
+var (
+	compressorsLk sync.RWMutex
+	compressors   = map[int]Compressor{}
+)
+
+// RegisterCompressor installs a Compressor for events of the given evtype
+// (one of xevent's event type constants, like xevent.ConfigureNotify).
+// Registering a second Compressor for the same evtype replaces the first.
+func RegisterCompressor(evtype int, c Compressor) {
+	compressorsLk.Lock()
+	defer compressorsLk.Unlock()
+	compressors[evtype] = c
+}
+
+// compress repeatedly peeks at the queue and folds in any upcoming event
+// that the registered Compressor for 'evtype' says continues the same run
+// as 'ev'. It's the same shape as the original hand-rolled MotionNotify
+// loop: flush the connection, read without blocking, then walk the queue
+// looking for the first event that matches, skipping over any that don't.
+// A match is merged in and popped off, and the walk starts over; it stops
+// once a whole pass over the queue finds no match.
+//
+// If no Compressor is registered for 'evtype', 'ev' is returned unchanged.
+func compress(xu *xgbutil.XUtil, evtype int, ev xgb.Event) xgb.Event {
+	compressorsLk.RLock()
+	c, ok := compressors[evtype]
+	compressorsLk.RUnlock()
+	if !ok {
+		return ev
+	}
+
+	for {
+		xu.Sync()
+		Read(xu, false)
+
+		found := false
+		for i, ee := range Peek(xu) {
+			if ee.Err != nil {
+				continue
+			}
+			if c.Match(ev, ee.Event) {
+				ev = c.Merge(ev, ee.Event)
+				DequeueAt(xu, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return ev
+}
@@ -0,0 +1,101 @@
+package xevent
+
+/*
+xevent/compress_builtin.go ships the Compressor implementations that used
+to be (MotionNotify) or could usefully be (ConfigureNotify, Expose,
+PropertyNotify) baked into processEventQueue.
+*/
+
+import (
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+func init() {
+	RegisterCompressor(MotionNotify, motionCompressor{})
+	RegisterCompressor(ConfigureNotify, configureCompressor{})
+	RegisterCompressor(Expose, exposeCompressor{})
+	RegisterCompressor(PropertyNotify, propertyCompressor{})
+}
+
+// motionCompressor keeps only the most recent MotionNotify per window,
+// which is what processEventQueue did by hand before Compressor existed.
+type motionCompressor struct{}
+
+func (motionCompressor) Match(prev, next xgb.Event) bool {
+	p, ok1 := prev.(xproto.MotionNotifyEvent)
+	n, ok2 := next.(xproto.MotionNotifyEvent)
+	return ok1 && ok2 && p.Event == n.Event
+}
+
+func (motionCompressor) Merge(prev, next xgb.Event) xgb.Event {
+	return next
+}
+
+// configureCompressor keeps only the most recent geometry per window
+// during something like an interactive resize.
+type configureCompressor struct{}
+
+func (configureCompressor) Match(prev, next xgb.Event) bool {
+	p, ok1 := prev.(xproto.ConfigureNotifyEvent)
+	n, ok2 := next.(xproto.ConfigureNotifyEvent)
+	return ok1 && ok2 && p.Event == n.Event
+}
+
+func (configureCompressor) Merge(prev, next xgb.Event) xgb.Event {
+	return next
+}
+
+// exposeCompressor unions the dirty rectangles of an Expose sequence for
+// the same window into one, so a repaint handler gets a single bounding
+// rectangle instead of redrawing once per rectangle. Count is taken from
+// 'next' since it reflects how many Expose events remain in the sequence
+// after the one being merged in.
+type exposeCompressor struct{}
+
+func (exposeCompressor) Match(prev, next xgb.Event) bool {
+	p, ok1 := prev.(xproto.ExposeEvent)
+	n, ok2 := next.(xproto.ExposeEvent)
+	return ok1 && ok2 && p.Window == n.Window
+}
+
+func (exposeCompressor) Merge(prev, next xgb.Event) xgb.Event {
+	p := prev.(xproto.ExposeEvent)
+	n := next.(xproto.ExposeEvent)
+
+	x0, y0 := min16(p.X, n.X), min16(p.Y, n.Y)
+	x1 := max16(p.X+p.Width, n.X+n.Width)
+	y1 := max16(p.Y+p.Height, n.Y+n.Height)
+
+	n.X, n.Y = x0, y0
+	n.Width, n.Height = x1-x0, y1-y0
+	return n
+}
+
+func min16(a, b uint16) uint16 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max16(a, b uint16) uint16 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// propertyCompressor drops duplicate PropertyNotify events for the same
+// window and atom, keeping only the latest state/time.
+type propertyCompressor struct{}
+
+func (propertyCompressor) Match(prev, next xgb.Event) bool {
+	p, ok1 := prev.(xproto.PropertyNotifyEvent)
+	n, ok2 := next.(xproto.PropertyNotifyEvent)
+	return ok1 && ok2 && p.Window == n.Window && p.Atom == n.Atom
+}
+
+func (propertyCompressor) Merge(prev, next xgb.Event) xgb.Event {
+	return next
+}
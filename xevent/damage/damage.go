@@ -0,0 +1,74 @@
+// Package damage provides xevent integration for the DAMAGE extension.
+//
+// A compositor that creates damage regions with damage.CreateChecked needs
+// to know when they're reported dirty. This package wraps damage's Notify
+// event and registers it with xevent.RegisterExtensionEvent, so it arrives
+// through the usual xevent.Main/MainPing loop instead of being dropped as
+// an unsupported event type.
+package damage
+
+import (
+	"errors"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/damage"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+// Notify is the event type constant used with xevent's callback machinery.
+// It's allocated from xevent's shared extension evtype counter rather than
+// a local iota, so it can't collide with randr's, shape's, or any other
+// extension package's.
+var Notify = xevent.NewExtensionEvtype()
+
+// NotifyEvent wraps damage.NotifyEvent.
+type NotifyEvent struct {
+	*damage.NotifyEvent
+}
+
+// NotifyFun is the callback function type for damage's Notify event.
+type NotifyFun func(xu *xgbutil.XUtil, e NotifyEvent)
+
+// Connect registers 'cb' to run whenever the damage region identified by
+// 'dmg' is reported dirty.
+func (cb NotifyFun) Connect(xu *xgbutil.XUtil, dmg damage.Damage) {
+	xevent.ConnectExtension(xu, Notify, xproto.Window(dmg), cb)
+}
+
+// Run satisfies xevent.ExtensionCallback.
+func (cb NotifyFun) Run(xu *xgbutil.XUtil, ev interface{}) {
+	cb(xu, ev.(NotifyEvent))
+}
+
+// Init confirms the DAMAGE extension is present and registers its Notify
+// event with xevent. It must be called after damage.Init(xu.Conn()) has
+// succeeded, and before xevent.Main is started.
+func Init(xu *xgbutil.XUtil) error {
+	reply, err := xproto.QueryExtension(xu.Conn(), uint16(len("DAMAGE")),
+		"DAMAGE").Reply()
+	if err != nil {
+		return err
+	}
+	if !reply.Present {
+		return errors.New("xevent/damage: DAMAGE extension is not present")
+	}
+	xevent.RegisterExtensionEvent(damage.NotifyEvent{}, dispatchNotify)
+	return nil
+}
+
+func dispatchNotify(xu *xgbutil.XUtil, ev xgb.Event) {
+	raw, ok := ev.(damage.NotifyEvent)
+	if !ok {
+		return
+	}
+	e := NotifyEvent{&raw}
+	xu.TimeSet(e.Timestamp)
+
+	// Notify targets the damage object itself, not a window, so we key
+	// callbacks off of it by treating its numeric id as a window id --
+	// same trick xevent uses for GraphicsExposureEvent's Drawable.
+	xevent.RunExtension(xu, e, Notify, xproto.Window(e.Damage))
+}
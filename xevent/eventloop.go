@@ -11,6 +11,9 @@ loop.
 */
 
 import (
+	"encoding/binary"
+
+	"github.com/BurntSushi/xgb"
 	"github.com/BurntSushi/xgb/xproto"
 
 	"github.com/BurntSushi/xgbutil"
@@ -43,7 +46,7 @@ func Read(xu *xgbutil.XUtil, block bool) {
 }
 
 // Main starts the main X event loop. It will read events and call appropriate
-// callback functions. 
+// callback functions.
 // N.B. If you have multiple X connections in the same program, you should be
 // able to run this in different goroutines concurrently. However, only
 // *one* of these should run for *each* connection.
@@ -66,7 +69,8 @@ func Main(xu *xgbutil.XUtil) {
 //	}
 //
 // Note that an unbuffered channel is returned, which implies that any work
-// done in 'val' will delay further X event processing.
+// done in 'val' will delay further X event processing. See MainPingContext
+// for a version that doesn't have this problem.
 // N.B. If you have multiple X connections in the same program, you should be
 // able to run this in different goroutines concurrently. However, only
 // *one* of these should run for *each* connection.
@@ -122,180 +126,178 @@ func processEventQueue(xu *xgbutil.XUtil, ping chan struct{}) {
 			xgbutil.Logger.Fatal("BUG: Expected an event but got nil.")
 		}
 
-		switch event := ev.(type) {
-		case xproto.KeyPressEvent:
-			e := KeyPressEvent{&event}
-
-			// If we're redirecting key events, this is the place to do it!
-			if wid := RedirectKeyGet(xu); wid > 0 {
-				e.Event = wid
-			}
-
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, KeyPress, e.Event)
-		case xproto.KeyReleaseEvent:
-			e := KeyReleaseEvent{&event}
+		dispatchEvent(xu, ev)
+	}
+}
 
-			// If we're redirecting key events, this is the place to do it!
-			if wid := RedirectKeyGet(xu); wid > 0 {
-				e.Event = wid
-			}
+// dispatchEvent translates one dequeued event into a run of its event
+// type's callbacks. It's shared by processEventQueue and its
+// MainPingContext counterpart, processEventQueueContext.
+func dispatchEvent(xu *xgbutil.XUtil, ev xgb.Event) {
+	switch event := ev.(type) {
+	case xproto.KeyPressEvent:
+		e := KeyPressEvent{&event}
 
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, KeyRelease, e.Event)
-		case xproto.ButtonPressEvent:
-			e := ButtonPressEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, ButtonPress, e.Event)
-		case xproto.ButtonReleaseEvent:
-			e := ButtonReleaseEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, ButtonRelease, e.Event)
-		case xproto.MotionNotifyEvent:
-			e := MotionNotifyEvent{&event}
+		// If we're redirecting key events, this is the place to do it!
+		if wid := RedirectKeyGet(xu); wid > 0 {
+			e.Event = wid
+		}
 
-			// Peek at the next events, if it's just another
-			// MotionNotify, let's compress!
-			// This is actually pretty nasty. The key here is to flush
-			// the buffer so we have an updated list of events.
-			// Then we read those events into our queue, but don't block
-			// while we do. Finally, we look through the queue and start
-			// popping off motion notifies that match 'e'. If we pop one
-			// off, restart the process of finding a motion notify.
-			// Otherwise, we're done and we move on with the current
-			// motion notify.
-			var laste xproto.MotionNotifyEvent
-			for {
-				xu.Sync()
-				Read(xu, false)
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, KeyPress, e.Event)
+	case xproto.KeyReleaseEvent:
+		e := KeyReleaseEvent{&event}
 
-				found := false
-				for i, ee := range Peek(xu) {
-					if ee.Err != nil {
-						continue
-					}
-					if mn, ok := ee.Event.(xproto.MotionNotifyEvent); ok {
-						if mn.Event == e.Event {
-							laste = mn
-							DequeueAt(xu, i)
-							found = true
-							break
-						}
-					}
-				}
-				if !found {
-					break
-				}
-			}
+		// If we're redirecting key events, this is the place to do it!
+		if wid := RedirectKeyGet(xu); wid > 0 {
+			e.Event = wid
+		}
 
-			if laste.Root != 0 {
-				e.Time = laste.Time
-				e.RootX = laste.RootX
-				e.RootY = laste.RootY
-				e.EventX = laste.EventX
-				e.EventY = laste.EventY
-			}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, KeyRelease, e.Event)
+	case xproto.ButtonPressEvent:
+		e := ButtonPressEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, ButtonPress, e.Event)
+	case xproto.ButtonReleaseEvent:
+		e := ButtonReleaseEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, ButtonRelease, e.Event)
+	case xproto.MotionNotifyEvent:
+		// Compress runs of MotionNotify for the same window into the
+		// most recent one, so a flick of the mouse doesn't mean
+		// processing every single point along the way. See
+		// xevent/compress.go and xevent/compress_builtin.go -- this
+		// used to be hard-coded here, but ConfigureNotify and Expose
+		// storms deserve the same treatment, so it's now pluggable.
+		compressed := compress(xu, MotionNotify, event)
+		event = compressed.(xproto.MotionNotifyEvent)
+		e := MotionNotifyEvent{&event}
 
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, MotionNotify, e.Event)
-		case xproto.EnterNotifyEvent:
-			e := EnterNotifyEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, EnterNotify, e.Event)
-		case xproto.LeaveNotifyEvent:
-			e := LeaveNotifyEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, LeaveNotify, e.Event)
-		case xproto.FocusInEvent:
-			e := FocusInEvent{&event}
-			runCallbacks(xu, e, FocusIn, e.Event)
-		case xproto.FocusOutEvent:
-			e := FocusOutEvent{&event}
-			runCallbacks(xu, e, FocusOut, e.Event)
-		case xproto.KeymapNotifyEvent:
-			e := KeymapNotifyEvent{&event}
-			runCallbacks(xu, e, KeymapNotify, NoWindow)
-		case xproto.ExposeEvent:
-			e := ExposeEvent{&event}
-			runCallbacks(xu, e, Expose, e.Window)
-		case xproto.GraphicsExposureEvent:
-			e := GraphicsExposureEvent{&event}
-			runCallbacks(xu, e, GraphicsExposure, xproto.Window(e.Drawable))
-		case xproto.NoExposureEvent:
-			e := NoExposureEvent{&event}
-			runCallbacks(xu, e, NoExposure, xproto.Window(e.Drawable))
-		case xproto.VisibilityNotifyEvent:
-			e := VisibilityNotifyEvent{&event}
-			runCallbacks(xu, e, VisibilityNotify, e.Window)
-		case xproto.CreateNotifyEvent:
-			e := CreateNotifyEvent{&event}
-			runCallbacks(xu, e, CreateNotify, e.Window)
-		case xproto.DestroyNotifyEvent:
-			e := DestroyNotifyEvent{&event}
-			runCallbacks(xu, e, DestroyNotify, e.Window)
-		case xproto.UnmapNotifyEvent:
-			e := UnmapNotifyEvent{&event}
-			runCallbacks(xu, e, UnmapNotify, e.Window)
-		case xproto.MapNotifyEvent:
-			e := MapNotifyEvent{&event}
-			runCallbacks(xu, e, MapNotify, e.Window)
-		case xproto.MapRequestEvent:
-			e := MapRequestEvent{&event}
-			runCallbacks(xu, e, MapRequest, e.Window)
-			runCallbacks(xu, e, MapRequest, e.Parent)
-		case xproto.ReparentNotifyEvent:
-			e := ReparentNotifyEvent{&event}
-			runCallbacks(xu, e, ReparentNotify, e.Window)
-		case xproto.ConfigureNotifyEvent:
-			e := ConfigureNotifyEvent{&event}
-			runCallbacks(xu, e, ConfigureNotify, e.Window)
-		case xproto.ConfigureRequestEvent:
-			e := ConfigureRequestEvent{&event}
-			runCallbacks(xu, e, ConfigureRequest, e.Window)
-			runCallbacks(xu, e, ConfigureRequest, e.Parent)
-		case xproto.GravityNotifyEvent:
-			e := GravityNotifyEvent{&event}
-			runCallbacks(xu, e, GravityNotify, e.Window)
-		case xproto.ResizeRequestEvent:
-			e := ResizeRequestEvent{&event}
-			runCallbacks(xu, e, ResizeRequest, e.Window)
-		case xproto.CirculateNotifyEvent:
-			e := CirculateNotifyEvent{&event}
-			runCallbacks(xu, e, CirculateNotify, e.Window)
-		case xproto.CirculateRequestEvent:
-			e := CirculateRequestEvent{&event}
-			runCallbacks(xu, e, CirculateRequest, e.Window)
-		case xproto.PropertyNotifyEvent:
-			e := PropertyNotifyEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, PropertyNotify, e.Window)
-		case xproto.SelectionClearEvent:
-			e := SelectionClearEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, SelectionClear, e.Owner)
-		case xproto.SelectionRequestEvent:
-			e := SelectionRequestEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, SelectionRequest, e.Requestor)
-		case xproto.SelectionNotifyEvent:
-			e := SelectionNotifyEvent{&event}
-			xu.TimeSet(e.Time)
-			runCallbacks(xu, e, SelectionNotify, e.Requestor)
-		case xproto.ColormapNotifyEvent:
-			e := ColormapNotifyEvent{&event}
-			runCallbacks(xu, e, ColormapNotify, e.Window)
-		case xproto.ClientMessageEvent:
-			e := ClientMessageEvent{&event}
-			runCallbacks(xu, e, ClientMessage, e.Window)
-		case xproto.MappingNotifyEvent:
-			e := MappingNotifyEvent{&event}
-			runCallbacks(xu, e, MappingNotify, NoWindow)
-		default:
-			if event != nil {
-				xgbutil.Logger.Printf("ERROR: UNSUPPORTED EVENT TYPE: %T",
-					event)
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, MotionNotify, e.Event)
+	case xproto.EnterNotifyEvent:
+		e := EnterNotifyEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, EnterNotify, e.Event)
+	case xproto.LeaveNotifyEvent:
+		e := LeaveNotifyEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, LeaveNotify, e.Event)
+	case xproto.FocusInEvent:
+		e := FocusInEvent{&event}
+		runCallbacks(xu, e, FocusIn, e.Event)
+	case xproto.FocusOutEvent:
+		e := FocusOutEvent{&event}
+		runCallbacks(xu, e, FocusOut, e.Event)
+	case xproto.KeymapNotifyEvent:
+		e := KeymapNotifyEvent{&event}
+		runCallbacks(xu, e, KeymapNotify, NoWindow)
+	case xproto.ExposeEvent:
+		event = compress(xu, Expose, event).(xproto.ExposeEvent)
+		e := ExposeEvent{&event}
+		runCallbacks(xu, e, Expose, e.Window)
+	case xproto.GraphicsExposureEvent:
+		e := GraphicsExposureEvent{&event}
+		runCallbacks(xu, e, GraphicsExposure, xproto.Window(e.Drawable))
+	case xproto.NoExposureEvent:
+		e := NoExposureEvent{&event}
+		runCallbacks(xu, e, NoExposure, xproto.Window(e.Drawable))
+	case xproto.VisibilityNotifyEvent:
+		e := VisibilityNotifyEvent{&event}
+		runCallbacks(xu, e, VisibilityNotify, e.Window)
+	case xproto.CreateNotifyEvent:
+		e := CreateNotifyEvent{&event}
+		runCallbacks(xu, e, CreateNotify, e.Window)
+	case xproto.DestroyNotifyEvent:
+		e := DestroyNotifyEvent{&event}
+		runCallbacks(xu, e, DestroyNotify, e.Window)
+	case xproto.UnmapNotifyEvent:
+		e := UnmapNotifyEvent{&event}
+		runCallbacks(xu, e, UnmapNotify, e.Window)
+	case xproto.MapNotifyEvent:
+		e := MapNotifyEvent{&event}
+		runCallbacks(xu, e, MapNotify, e.Window)
+	case xproto.MapRequestEvent:
+		e := MapRequestEvent{&event}
+		runCallbacks(xu, e, MapRequest, e.Window)
+		runCallbacks(xu, e, MapRequest, e.Parent)
+	case xproto.ReparentNotifyEvent:
+		e := ReparentNotifyEvent{&event}
+		runCallbacks(xu, e, ReparentNotify, e.Window)
+	case xproto.ConfigureNotifyEvent:
+		event = compress(xu, ConfigureNotify, event).(xproto.ConfigureNotifyEvent)
+		e := ConfigureNotifyEvent{&event}
+		runCallbacks(xu, e, ConfigureNotify, e.Window)
+	case xproto.ConfigureRequestEvent:
+		e := ConfigureRequestEvent{&event}
+		runCallbacks(xu, e, ConfigureRequest, e.Window)
+		runCallbacks(xu, e, ConfigureRequest, e.Parent)
+	case xproto.GravityNotifyEvent:
+		e := GravityNotifyEvent{&event}
+		runCallbacks(xu, e, GravityNotify, e.Window)
+	case xproto.ResizeRequestEvent:
+		e := ResizeRequestEvent{&event}
+		runCallbacks(xu, e, ResizeRequest, e.Window)
+	case xproto.CirculateNotifyEvent:
+		e := CirculateNotifyEvent{&event}
+		runCallbacks(xu, e, CirculateNotify, e.Window)
+	case xproto.CirculateRequestEvent:
+		e := CirculateRequestEvent{&event}
+		runCallbacks(xu, e, CirculateRequest, e.Window)
+	case xproto.PropertyNotifyEvent:
+		event = compress(xu, PropertyNotify, event).(xproto.PropertyNotifyEvent)
+		e := PropertyNotifyEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, PropertyNotify, e.Window)
+	case xproto.SelectionClearEvent:
+		e := SelectionClearEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, SelectionClear, e.Owner)
+	case xproto.SelectionRequestEvent:
+		e := SelectionRequestEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, SelectionRequest, e.Requestor)
+	case xproto.SelectionNotifyEvent:
+		e := SelectionNotifyEvent{&event}
+		xu.TimeSet(e.Time)
+		runCallbacks(xu, e, SelectionNotify, e.Requestor)
+	case xproto.ColormapNotifyEvent:
+		e := ColormapNotifyEvent{&event}
+		runCallbacks(xu, e, ColormapNotify, e.Window)
+	case xproto.ClientMessageEvent:
+		e := ClientMessageEvent{&event}
+		runCallbacks(xu, e, ClientMessage, e.Window)
+	case xproto.MappingNotifyEvent:
+		e := MappingNotifyEvent{&event}
+		runCallbacks(xu, e, MappingNotify, NoWindow)
+	case xproto.GeGenericEvent:
+		// XGE carries payloads for XInput2, Present and other modern
+		// extensions. xproto's generated struct only exposes the bits
+		// common to every core event (Sequence); the extension opcode
+		// and sub-event (evtype) that actually distinguish one XGE
+		// event from another live at fixed byte offsets in the wire
+		// form instead, so pull them out of Bytes() directly. See
+		// xevent/generic.go and xevent/xinput.
+		buf := event.Bytes()
+		major := buf[1]
+		evtype := binary.LittleEndian.Uint16(buf[8:10])
+		if !dispatchGenericEvent(xu, major, evtype, buf) {
+			xgbutil.Logger.Printf("ERROR: UNSUPPORTED GENERIC EVENT: "+
+				"extension=%d evtype=%d", major, evtype)
+		}
+	default:
+		if event != nil {
+			// Core xproto doesn't know about extension events (RandR,
+			// Damage, Shape, Xinerama, etc.), so look for a dispatcher
+			// registered for this event's own Go type before giving up
+			// on it. See xevent/extension.go for why that's the key
+			// instead of the event's wire number.
+			if dispatchExtensionEvent(xu, event) {
+				return
 			}
-			continue
+			xgbutil.Logger.Printf("ERROR: UNSUPPORTED EVENT TYPE: %T",
+				event)
 		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,132 @@
+package xevent
+
+/*
+xevent/extension.go adds a registration point for X extension events.
+
+processEventQueue only knows how to type-switch on the core xproto events.
+Everything else -- RandR, Damage, Shape, Xinerama, XFixes, and friends --
+falls into the "UNSUPPORTED EVENT TYPE" branch because xevent has no way of
+knowing what to do with them. Extension packages (see xevent/randr,
+xevent/damage, xevent/shape and xevent/xinerama) call RegisterExtensionEvent
+to plug their events into the same callback machinery that core events use.
+
+Dispatch is keyed on the decoded event's own Go type, not its raw wire
+event number. xgb already decodes each extension event into a distinct Go
+type per (extension, sub-event) pair -- that's how it picked the right
+decoder in the first place -- but it doesn't hand the raw event number
+back out alongside the result, and a decoded event's Bytes() reconstructs
+the wire form using the event's *local* offset within its extension
+(always starting back at 0), not the server-assigned base+offset number.
+So by the time an event reaches here, its Go type is the only reliable
+thing left to dispatch on.
+*/
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+)
+
+// ExtensionDispatch is the function signature used to translate a decoded
+// extension event into xevent's callback machinery, usually by wrapping
+// 'ev' in a typed struct and calling xevent.RunExtension.
+type ExtensionDispatch func(xu *xgbutil.XUtil, ev xgb.Event)
+
+var (
+	extensionEventsLk sync.RWMutex
+	extensionEvents   = map[reflect.Type]ExtensionDispatch{}
+)
+
+// extensionEvtypeBase offsets evtypes handed out by NewExtensionEvtype
+// well past xproto's own small sequential constants, and well below
+// genericEvtypeBase (xevent/generic.go), so core, extension and XGE
+// evtypes can all share the same callback tables without colliding.
+const extensionEvtypeBase = 1 << 16
+
+var (
+	nextExtensionEvtypeLk sync.Mutex
+	nextExtensionEvtype   = extensionEvtypeBase
+)
+
+// NewExtensionEvtype hands out a fresh evtype for an extension package's
+// own event -- RandR's ScreenChangeNotify/Notify, Damage's Notify, Shape's
+// Notify, and so on -- to use with RegisterExtensionEvent/ConnectExtension.
+// Allocating from this shared counter, instead of each package picking its
+// own small int via a local iota block, means two unrelated extension
+// packages can never collide on the same (evtype, win) key in xu's
+// callback tables.
+func NewExtensionEvtype() int {
+	nextExtensionEvtypeLk.Lock()
+	defer nextExtensionEvtypeLk.Unlock()
+	v := nextExtensionEvtype
+	nextExtensionEvtype++
+	return v
+}
+
+// RegisterExtensionEvent associates the concrete Go type of an extension
+// event with a dispatch function. 'sample' is only ever used as a type
+// tag -- pass a zero value of the event type being registered, e.g.
+// RegisterExtensionEvent(randr.ScreenChangeNotifyEvent{}, dispatch).
+//
+// This lives here, rather than in each extension package, so that a
+// single registry can be consulted from the main event loop no matter
+// which extension packages a program has imported.
+func RegisterExtensionEvent(sample xgb.Event, dispatch ExtensionDispatch) {
+	extensionEventsLk.Lock()
+	defer extensionEventsLk.Unlock()
+	extensionEvents[reflect.TypeOf(sample)] = dispatch
+}
+
+// RunExtension runs the callbacks registered for an extension event. It is
+// exported so that extension packages -- which cannot see xevent's
+// unexported runCallbacks -- can still feed their events through the same
+// callback tables that core events use.
+func RunExtension(xu *xgbutil.XUtil, event interface{}, evtype int, win xproto.Window) {
+	runCallbacks(xu, event, evtype, win)
+}
+
+// ExtensionCallback is the part of xgbutil.Callback that ConnectExtension
+// actually needs: something to run once an event is dispatched. Extension
+// packages' own "Fun" types each give Connect a different, more ergonomic
+// signature for their own public API -- damage.NotifyFun.Connect takes a
+// damage.Damage instead of a window, randr's take no window at all -- so
+// most of them don't implement xgbutil.Callback's Connect, and
+// ConnectExtension asks only for Run.
+type ExtensionCallback interface {
+	Run(xu *xgbutil.XUtil, ev interface{})
+}
+
+// runOnlyCallback adapts an ExtensionCallback to xgbutil.Callback with a
+// no-op Connect, so it can be handed to attachCallback, which expects the
+// full interface. Its own Connect is never invoked: that's left to each
+// extension package's own ergonomic Connect method, which is what called
+// ConnectExtension in the first place.
+type runOnlyCallback struct{ ExtensionCallback }
+
+func (runOnlyCallback) Connect(xu *xgbutil.XUtil, win xproto.Window) {}
+
+// ConnectExtension registers fun to run when an event of evtype is
+// dispatched to win. It exists so that extension packages -- which cannot
+// see xevent's unexported attachCallback -- can still plug into the same
+// callback tables that core events use.
+func ConnectExtension(xu *xgbutil.XUtil, evtype int, win xproto.Window, fun ExtensionCallback) {
+	attachCallback(xu, evtype, win, runOnlyCallback{fun})
+}
+
+// dispatchExtensionEvent looks for a dispatcher registered for ev's
+// concrete type and runs it. It reports whether a dispatcher was found,
+// so the caller can fall back to the usual "unsupported event" logging.
+func dispatchExtensionEvent(xu *xgbutil.XUtil, ev xgb.Event) bool {
+	extensionEventsLk.RLock()
+	dispatch, ok := extensionEvents[reflect.TypeOf(ev)]
+	extensionEventsLk.RUnlock()
+	if !ok {
+		return false
+	}
+	dispatch(xu, ev)
+	return true
+}
@@ -0,0 +1,87 @@
+package xevent
+
+/*
+xevent/generic.go demultiplexes X's Generic Event Extension (opcode 35).
+
+XGE is how XInput2, Present and other modern extensions deliver events.
+Unlike RandR/Damage/Shape (see xevent/extension.go), every XGE event shares
+the same wire code -- GeGenericEvent's own response_type is always 35 no
+matter which extension sent it. Telling them apart needs two more fields
+from the payload: the extension's major opcode and its own 'evtype'. This
+file keys a registry on that pair.
+*/
+
+import (
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+)
+
+// GenericDecode turns the raw bytes of an XGE event into a typed
+// xgb.Event.
+type GenericDecode func(buf []byte) xgb.Event
+
+// GenericTarget picks the xproto.Window a decoded XGE event should be
+// delivered to.
+type GenericTarget func(ev xgb.Event) xproto.Window
+
+type genericKey struct {
+	major  byte
+	evtype uint16
+}
+
+type genericHandler struct {
+	decode GenericDecode
+	target GenericTarget
+}
+
+// genericEvtypeBase offsets synthetic XGE evtypes well past xproto's small
+// sequential constants and the evtypes xevent/extension.go hands out from
+// extensionEvtypeBase (1 << 16) up, so the three schemes can share the same
+// callback tables without colliding.
+const genericEvtypeBase = 1 << 24
+
+var (
+	genericEventsLk sync.RWMutex
+	genericEvents   = map[genericKey]genericHandler{}
+)
+
+// RegisterGenericEvent associates an extension's major opcode and XGE
+// evtype with a decoder and a target-window extractor. 'major' should come
+// from the extension's own QueryExtension reply (cached by the extension
+// package at Init time) rather than a hard-coded constant, since the
+// server assigns opcodes dynamically. See xevent/xinput for an example.
+func RegisterGenericEvent(major byte, evtype uint16, decode GenericDecode,
+	target GenericTarget) {
+
+	genericEventsLk.Lock()
+	defer genericEventsLk.Unlock()
+	genericEvents[genericKey{major, evtype}] = genericHandler{decode, target}
+}
+
+// GenericEvtype returns the synthetic evtype xevent uses internally to key
+// callbacks registered against a (major, evtype) XGE pair. Extension
+// packages need it to call xevent.ConnectExtension directly.
+func GenericEvtype(major byte, evtype uint16) int {
+	return genericEvtypeBase + int(major)<<16 + int(evtype)
+}
+
+// dispatchGenericEvent looks up, decodes and runs callbacks for an XGE
+// event. It reports whether a handler was registered for (major, evtype).
+func dispatchGenericEvent(xu *xgbutil.XUtil, major byte, evtype uint16,
+	buf []byte) bool {
+
+	genericEventsLk.RLock()
+	h, ok := genericEvents[genericKey{major, evtype}]
+	genericEventsLk.RUnlock()
+	if !ok {
+		return false
+	}
+
+	event := h.decode(buf)
+	runCallbacks(xu, event, GenericEvtype(major, evtype), h.target(event))
+	return true
+}
@@ -0,0 +1,197 @@
+package xevent
+
+/*
+xevent/multiplex.go lets a program run one event loop over several X
+connections at once.
+
+Main and MainPing are documented as one-per-connection: each spawns its own
+goroutine reading a single *xgbutil.XUtil. Programs that hold an auxiliary
+connection -- a compositor pairing its main connection with a second one
+for SHM/DAMAGE, a screen-capture tool, and so on -- end up hand-rolling
+their own fan-in of several such goroutines. Multiplexer is that fan-in,
+built once instead of by every caller.
+*/
+
+import (
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+
+	"github.com/BurntSushi/xgbutil"
+)
+
+// MultiEvent pairs a decoded event (or a read error) with the connection
+// it came from.
+type MultiEvent struct {
+	XUtil *xgbutil.XUtil
+	Event xgb.Event
+	Err   xgb.Error
+}
+
+// Multiplexer fans events in from several XUtil connections. Each
+// connection gets its own reader goroutine; a single dispatcher goroutine
+// interleaves their output, runs it through that connection's own
+// callback tables (so ordinary xevent.Connect-style handlers keep firing,
+// exactly as under Main), and republishes it on Events().
+type Multiplexer struct {
+	conns   []*xgbutil.XUtil
+	events  chan MultiEvent
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Multiplex creates a Multiplexer for the given connections. Call Run to
+// start reading from them.
+func Multiplex(conns ...*xgbutil.XUtil) *Multiplexer {
+	return &Multiplexer{
+		conns:   conns,
+		events:  make(chan MultiEvent),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Events returns the channel that every connection's events (and read
+// errors) are merged onto, tagged with the connection they came from.
+func (m *Multiplexer) Events() <-chan MultiEvent {
+	return m.events
+}
+
+// Run starts one reader goroutine per connection plus a dispatcher
+// goroutine, and returns immediately. Call Stop to shut everything down.
+func (m *Multiplexer) Run() {
+	fanIn := make(chan MultiEvent)
+
+	var wg sync.WaitGroup
+	for _, xu := range m.conns {
+		wg.Add(1)
+		go m.read(xu, fanIn, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(fanIn)
+	}()
+
+	go m.dispatch(fanIn)
+}
+
+// Stop tells every reader goroutine to stop and waits for the dispatcher
+// to drain. It's safe to call more than once.
+func (m *Multiplexer) Stop() {
+	m.once.Do(func() { close(m.stop) })
+	<-m.stopped
+}
+
+// SelectPing returns a channel that receives a benign value every time an
+// event from any of this Multiplexer's connections is dispatched -- the
+// multi-connection equivalent of MainPing's ping channel, coalesced the
+// same way MainPingContext's is so a burst on one connection can't stall
+// a select loop watching other, non-X sources.
+//
+// SelectPing consumes Events() itself; don't also range over Events()
+// directly if you use it.
+func (m *Multiplexer) SelectPing() <-chan struct{} {
+	ping := make(chan struct{}, 1)
+	go func() {
+		for range m.events {
+			pingCoalesce(ping)
+		}
+	}()
+	return ping
+}
+
+// read pulls events off of a single connection until told to stop or the
+// connection dies, forwarding everything onto fanIn. WaitForEvent has no
+// way to be cancelled directly, so each read happens in its own
+// throwaway goroutine that's raced against m.stop; on stop, that
+// goroutine is left to finish (and be garbage collected) on its own.
+func (m *Multiplexer) read(xu *xgbutil.XUtil, fanIn chan<- MultiEvent,
+	wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	type result struct {
+		ev  xgb.Event
+		err xgb.Error
+	}
+
+	for {
+		if Quitting(xu) {
+			return
+		}
+
+		done := make(chan result, 1)
+		go func() {
+			ev, err := xu.Conn().WaitForEvent()
+			done <- result{ev, err}
+		}()
+
+		select {
+		case <-m.stop:
+			return
+		case r := <-done:
+			// Both nil means the connection is dead, not a protocol
+			// error -- those still arrive as a non-nil err on their own
+			// and don't stop the reader, same as core Read().
+			dead := r.ev == nil && r.err == nil
+			if dead {
+				r.err = connError(
+					"xevent: could not read an event or an error")
+			}
+			select {
+			case fanIn <- MultiEvent{XUtil: xu, Event: r.ev, Err: r.err}:
+			case <-m.stop:
+				return
+			}
+			if dead {
+				return
+			}
+		}
+	}
+}
+
+// dispatch interleaves fanIn's senders fairly (Go's channel scheduling
+// already does this for us, since they're all blocked on the same send),
+// runs each event through its connection's callback tables, and
+// republishes it on Events().
+func (m *Multiplexer) dispatch(fanIn <-chan MultiEvent) {
+	defer close(m.stopped)
+
+	for me := range fanIn {
+		if !m.dispatchOne(me) {
+			return
+		}
+
+		// dispatchEvent's compress() may have polled extra events off
+		// me.XUtil's wire into its own internal queue -- the same one
+		// processEventQueue drains under Main -- without anyone else
+		// around to drain it here. Do that now, so an event that didn't
+		// continue a compressible run isn't stranded there forever.
+		for !Empty(me.XUtil) {
+			ev, err := Dequeue(me.XUtil)
+			if !m.dispatchOne(MultiEvent{XUtil: me.XUtil, Event: ev, Err: err}) {
+				return
+			}
+		}
+	}
+}
+
+// dispatchOne runs a single event (or error) through its connection's
+// callback tables and republishes it on Events(). It reports whether the
+// Multiplexer is still running, so callers can stop looping once Stop has
+// been called.
+func (m *Multiplexer) dispatchOne(me MultiEvent) bool {
+	if me.Err != nil {
+		ErrorHandlerGet(me.XUtil)(me.Err)
+	} else {
+		dispatchEvent(me.XUtil, me.Event)
+	}
+
+	select {
+	case m.events <- me:
+		return true
+	case <-m.stop:
+		return false
+	}
+}
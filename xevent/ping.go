@@ -0,0 +1,178 @@
+package xevent
+
+/*
+xevent/ping.go adds a context-aware, coalescing alternative to MainPing.
+
+MainPing's ping channel is unbuffered, which means the entire X event loop
+stalls until whatever is on the other end of a caller's select gets around
+to receiving it -- a single slow tick in that other branch holds up every
+subsequent X event. MainPingContext fixes that with a buffered,
+drop-oldest channel, exits cleanly on context cancellation instead of
+running forever, and reports connection errors instead of calling
+xgbutil.Logger.Fatal.
+*/
+
+import (
+	"context"
+
+	"github.com/BurntSushi/xgb"
+
+	"github.com/BurntSushi/xgbutil"
+)
+
+// connError is a minimal xgb.Error used to report a dead connection --
+// WaitForEvent returning (nil, nil) -- on channels that otherwise carry
+// xgb.Error values from the wire, since errors.New's result only
+// satisfies the builtin error interface.
+type connError string
+
+func (e connError) Error() string      { return string(e) }
+func (e connError) BadId() uint32      { return 0 }
+func (e connError) SequenceId() uint16 { return 0 }
+
+// PingOptions configures MainPingContext.
+type PingOptions struct {
+	// BufferSize is the capacity of the returned ping channel. Values <= 1
+	// are treated as 1: there's always room for exactly one pending
+	// wake-up, and a burst of events collapses into a single ping rather
+	// than piling up.
+	BufferSize int
+}
+
+// MainPingContext starts the main X event loop and returns a ping channel
+// and an error channel, instead of blocking the calling goroutine like
+// Main does.
+//
+// The ping channel is buffered per opts.BufferSize with drop-oldest
+// coalescing: if hundreds of MotionNotifies arrive before the consumer
+// reads a ping, they still produce at most opts.BufferSize pending
+// wake-ups (one, with the default BufferSize) instead of stalling the X
+// connection or queueing up unboundedly.
+//
+// The loop exits -- calling Quit(xu) first -- as soon as ctx is done.
+// Because the X read that wakes the loop up is itself a blocking call,
+// a goroutine may briefly outlive the cancellation waiting for that read
+// to return; it exits on its own once it does, without blocking Quit.
+//
+// X connection errors that used to reach xgbutil.Logger.Fatal are instead
+// sent once on the returned error channel, which is then closed.
+func MainPingContext(ctx context.Context, xu *xgbutil.XUtil,
+	opts PingOptions) (<-chan struct{}, <-chan error) {
+
+	bufSize := opts.BufferSize
+	if bufSize < 1 {
+		bufSize = 1
+	}
+	ping := make(chan struct{}, bufSize)
+	errs := make(chan error, 1)
+
+	go mainEventLoopContext(ctx, xu, ping, errs)
+
+	return ping, errs
+}
+
+// pingCoalesce sends a ping without blocking. If the channel is full, the
+// oldest pending ping is dropped to make room, so the channel never holds
+// more than cap(ping) wake-ups no matter how fast events arrive -- one, for
+// a channel of capacity 1.
+func pingCoalesce(ping chan struct{}) {
+	select {
+	case ping <- struct{}{}:
+		return
+	default:
+	}
+
+	select {
+	case <-ping:
+	default:
+	}
+
+	select {
+	case ping <- struct{}{}:
+	default:
+	}
+}
+
+// waitForEventContext runs a blocking WaitForEvent in its own goroutine so
+// it can be raced against ctx.Done(). ok is false when ctx was cancelled
+// first; the spawned goroutine is left to finish on its own in that case.
+func waitForEventContext(ctx context.Context,
+	xu *xgbutil.XUtil) (ev xgb.Event, err xgb.Error, ok bool) {
+
+	type result struct {
+		ev  xgb.Event
+		err xgb.Error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ev, err := xu.Conn().WaitForEvent()
+		done <- result{ev, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, false
+	case r := <-done:
+		return r.ev, r.err, true
+	}
+}
+
+// mainEventLoopContext is MainPingContext's version of mainEventLoop.
+func mainEventLoopContext(ctx context.Context, xu *xgbutil.XUtil,
+	ping chan struct{}, errs chan<- error) {
+
+	defer close(errs)
+
+	for {
+		select {
+		case <-ctx.Done():
+			Quit(xu)
+			return
+		default:
+		}
+
+		if Quitting(xu) {
+			return
+		}
+
+		ev, err, ok := waitForEventContext(ctx, xu)
+		if !ok {
+			Quit(xu)
+			return
+		}
+		if ev == nil && err == nil {
+			errs <- connError("xevent: could not read an event or an error")
+			Quit(xu)
+			return
+		}
+		Enqueue(xu, ev, err)
+
+		// Gobble up anything else that's already queued up, same as Read.
+		Read(xu, false)
+
+		processEventQueueContext(xu, ping)
+	}
+}
+
+// processEventQueueContext is processEventQueue's ping-coalescing
+// counterpart.
+func processEventQueueContext(xu *xgbutil.XUtil, ping chan struct{}) {
+	for !Empty(xu) {
+		if Quitting(xu) {
+			return
+		}
+
+		pingCoalesce(ping)
+
+		ev, err := Dequeue(xu)
+		if err != nil {
+			ErrorHandlerGet(xu)(err)
+			continue
+		}
+		if ev == nil {
+			xgbutil.Logger.Fatal("BUG: Expected an event but got nil.")
+		}
+
+		dispatchEvent(xu, ev)
+	}
+}
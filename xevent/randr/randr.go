@@ -0,0 +1,112 @@
+// Package randr provides xevent integration for the RandR extension.
+//
+// RandR's ScreenChangeNotify and Notify events don't flow through
+// xevent's core event loop on their own -- core xevent only knows about
+// xproto events. This package wraps them in xevent-friendly types and
+// registers them with xevent.RegisterExtensionEvent, so that a window
+// manager or compositor that has already called randr.Init and
+// randr.SelectInputChecked can receive them through the same
+// xevent.Main/MainPing loop used for everything else.
+package randr
+
+import (
+	"errors"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+// Event type constants used with xevent's callback machinery. They're
+// analogous to xevent.KeyPress, xevent.ConfigureNotify, etc., just scoped
+// to this package instead of xproto. Allocated from xevent's shared
+// extension evtype counter rather than a local iota block, so they can't
+// collide with damage's, shape's, or any other extension package's.
+var (
+	ScreenChangeNotify = xevent.NewExtensionEvtype()
+	Notify             = xevent.NewExtensionEvtype()
+)
+
+// ScreenChangeNotifyEvent wraps randr.ScreenChangeNotifyEvent.
+type ScreenChangeNotifyEvent struct {
+	*randr.ScreenChangeNotifyEvent
+}
+
+// NotifyEvent wraps randr.NotifyEvent. Check the SubCode field to find out
+// whether it's a CrtcChange, OutputChange or OutputPropertyNotify.
+type NotifyEvent struct {
+	*randr.NotifyEvent
+}
+
+// ScreenChangeNotifyFun is the callback function type for ScreenChangeNotify.
+type ScreenChangeNotifyFun func(xu *xgbutil.XUtil, e ScreenChangeNotifyEvent)
+
+// Connect registers 'cb' to run whenever a ScreenChangeNotify event is
+// seen. ScreenChangeNotify has no natural target window, so it's always
+// delivered to xevent.NoWindow -- same as core's KeymapNotify.
+func (cb ScreenChangeNotifyFun) Connect(xu *xgbutil.XUtil) {
+	xevent.ConnectExtension(xu, ScreenChangeNotify, xevent.NoWindow, cb)
+}
+
+// Run satisfies xevent.ExtensionCallback.
+func (cb ScreenChangeNotifyFun) Run(xu *xgbutil.XUtil, ev interface{}) {
+	cb(xu, ev.(ScreenChangeNotifyEvent))
+}
+
+// NotifyFun is the callback function type for Notify (crtc/output/output
+// property changes).
+type NotifyFun func(xu *xgbutil.XUtil, e NotifyEvent)
+
+// Connect registers 'cb' to run whenever a Notify event is seen. Like
+// ScreenChangeNotify, it's delivered to xevent.NoWindow; inspect the
+// event's SubCode and union fields to find the output/crtc it concerns.
+func (cb NotifyFun) Connect(xu *xgbutil.XUtil) {
+	xevent.ConnectExtension(xu, Notify, xevent.NoWindow, cb)
+}
+
+// Run satisfies xevent.ExtensionCallback.
+func (cb NotifyFun) Run(xu *xgbutil.XUtil, ev interface{}) {
+	cb(xu, ev.(NotifyEvent))
+}
+
+// Init confirms the RandR extension is present and registers its events
+// with xevent, so they start flowing through xevent.Main/MainPing. It must
+// be called after randr.Init(xu.Conn()) has succeeded, and before
+// xevent.Main is started.
+func Init(xu *xgbutil.XUtil) error {
+	reply, err := xproto.QueryExtension(xu.Conn(), uint16(len("RANDR")),
+		"RANDR").Reply()
+	if err != nil {
+		return err
+	}
+	if !reply.Present {
+		return errors.New("xevent/randr: RANDR extension is not present")
+	}
+
+	xevent.RegisterExtensionEvent(randr.ScreenChangeNotifyEvent{},
+		dispatchScreenChangeNotify)
+	xevent.RegisterExtensionEvent(randr.NotifyEvent{}, dispatchNotify)
+	return nil
+}
+
+func dispatchScreenChangeNotify(xu *xgbutil.XUtil, ev xgb.Event) {
+	raw, ok := ev.(randr.ScreenChangeNotifyEvent)
+	if !ok {
+		return
+	}
+	e := ScreenChangeNotifyEvent{&raw}
+	xu.TimeSet(e.Timestamp)
+	xevent.RunExtension(xu, e, ScreenChangeNotify, xevent.NoWindow)
+}
+
+func dispatchNotify(xu *xgbutil.XUtil, ev xgb.Event) {
+	raw, ok := ev.(randr.NotifyEvent)
+	if !ok {
+		return
+	}
+	e := NotifyEvent{&raw}
+	xevent.RunExtension(xu, e, Notify, xevent.NoWindow)
+}
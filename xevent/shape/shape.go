@@ -0,0 +1,70 @@
+// Package shape provides xevent integration for the SHAPE extension.
+//
+// Programs that use non-rectangular windows want to know when a window's
+// bounding or clip shape changes, e.g. because a client resized or
+// reshaped itself. This package wraps shape's Notify event and registers
+// it with xevent.RegisterExtensionEvent, so it arrives through the usual
+// xevent.Main/MainPing loop instead of being dropped as an unsupported
+// event type.
+package shape
+
+import (
+	"errors"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/shape"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+// Notify is the event type constant used with xevent's callback machinery.
+// It's allocated from xevent's shared extension evtype counter rather than
+// a local iota, so it can't collide with randr's, damage's, or any other
+// extension package's.
+var Notify = xevent.NewExtensionEvtype()
+
+// NotifyEvent wraps shape.NotifyEvent.
+type NotifyEvent struct {
+	*shape.NotifyEvent
+}
+
+// NotifyFun is the callback function type for shape's Notify event.
+type NotifyFun func(xu *xgbutil.XUtil, e NotifyEvent)
+
+// Connect registers 'cb' to run whenever the given window's shape changes.
+func (cb NotifyFun) Connect(xu *xgbutil.XUtil, win xproto.Window) {
+	xevent.ConnectExtension(xu, Notify, win, cb)
+}
+
+// Run satisfies xevent.ExtensionCallback.
+func (cb NotifyFun) Run(xu *xgbutil.XUtil, ev interface{}) {
+	cb(xu, ev.(NotifyEvent))
+}
+
+// Init confirms the SHAPE extension is present and registers its Notify
+// event with xevent. It must be called after shape.Init(xu.Conn()) has
+// succeeded, and before xevent.Main is started.
+func Init(xu *xgbutil.XUtil) error {
+	reply, err := xproto.QueryExtension(xu.Conn(), uint16(len("SHAPE")),
+		"SHAPE").Reply()
+	if err != nil {
+		return err
+	}
+	if !reply.Present {
+		return errors.New("xevent/shape: SHAPE extension is not present")
+	}
+	xevent.RegisterExtensionEvent(shape.NotifyEvent{}, dispatchNotify)
+	return nil
+}
+
+func dispatchNotify(xu *xgbutil.XUtil, ev xgb.Event) {
+	raw, ok := ev.(shape.NotifyEvent)
+	if !ok {
+		return
+	}
+	e := NotifyEvent{&raw}
+	xu.TimeSet(e.ServerTime)
+	xevent.RunExtension(xu, e, Notify, e.AffectedWindow)
+}
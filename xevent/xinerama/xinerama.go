@@ -0,0 +1,48 @@
+// Package xinerama provides xevent-friendly helpers for the Xinerama
+// extension.
+//
+// Unlike RandR, Damage and Shape, Xinerama doesn't define any events of
+// its own -- xinerama.QueryScreens is a plain request/reply, so there's
+// nothing to register with xevent.RegisterExtensionEvent. What programs
+// actually want is to be told when the screen layout changes, which on
+// any modern server means reacting to RandR's ScreenChangeNotify and then
+// re-querying Xinerama's view of the screens. Screens queries this for
+// them.
+package xinerama
+
+import (
+	"github.com/BurntSushi/xgb/xinerama"
+
+	"github.com/BurntSushi/xgbutil"
+	xrandr "github.com/BurntSushi/xgbutil/xevent/randr"
+)
+
+// Screens re-queries Xinerama's screen list. It's a thin wrapper around
+// xinerama.QueryScreens meant to be called from a handler connected with
+// ConnectScreenChange.
+func Screens(xu *xgbutil.XUtil) ([]xinerama.ScreenInfo, error) {
+	reply, err := xinerama.QueryScreens(xu.Conn()).Reply()
+	if err != nil {
+		return nil, err
+	}
+	return reply.ScreenInfo, nil
+}
+
+// ConnectScreenChange registers 'cb' to run with an up to date screen list
+// every time RandR reports that the screen layout changed. It requires
+// that the randr package's Init has already been called on 'xu'.
+func ConnectScreenChange(xu *xgbutil.XUtil,
+	cb func(xu *xgbutil.XUtil, screens []xinerama.ScreenInfo)) {
+
+	fun := xrandr.ScreenChangeNotifyFun(
+		func(xu *xgbutil.XUtil, e xrandr.ScreenChangeNotifyEvent) {
+			screens, err := Screens(xu)
+			if err != nil {
+				xgbutil.Logger.Printf("ERROR: could not query Xinerama "+
+					"screens: %s", err)
+				return
+			}
+			cb(xu, screens)
+		})
+	fun.Connect(xu)
+}
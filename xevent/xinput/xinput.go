@@ -0,0 +1,193 @@
+// Package xinput provides xevent integration for XInput2's generic
+// events, the ones that travel over the X Generic Event Extension (XGE)
+// rather than as plain core events: raw pointer motion, raw key presses,
+// and touch. It decodes them and registers them with
+// xevent.RegisterGenericEvent, so they arrive through the usual
+// xevent.Main/MainPing loop.
+package xinput
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+// XI2's own event type numbers, as laid out in the XInput2 protocol spec.
+// These identify an event within XGE; they have nothing to do with the
+// core xproto event numbers of the same name.
+const (
+	xiRawKeyPress = 13
+	xiRawMotion   = 17
+	xiTouchBegin  = 18
+	xiTouchUpdate = 19
+	xiTouchEnd    = 20
+)
+
+// Event type constants used with xevent's callback machinery.
+var (
+	RawMotion   = xevent.GenericEvtype(0, xiRawMotion)
+	RawKeyPress = xevent.GenericEvtype(0, xiRawKeyPress)
+	TouchBegin  = xevent.GenericEvtype(0, xiTouchBegin)
+	TouchUpdate = xevent.GenericEvtype(0, xiTouchUpdate)
+	TouchEnd    = xevent.GenericEvtype(0, xiTouchEnd)
+)
+
+// major is XInput2's extension opcode, as reported by QueryExtension. It's
+// filled in by Init and folded into the constants above so user code can
+// still refer to them by name.
+var major byte
+
+// RawEvent covers RawMotion and RawKeyPress/RawButtonPress, which share
+// the same fixed-size header: there's no event/root/child window, just a
+// device, a timestamp and a detail (key code, button number, or unused for
+// motion).
+type RawEvent struct {
+	DeviceID int
+	Time     xproto.Timestamp
+	Detail   int
+
+	buf []byte
+}
+
+// Bytes satisfies xgb.Event, returning the raw XGE payload this event was
+// decoded from.
+func (e RawEvent) Bytes() []byte { return e.buf }
+
+// String satisfies xgb.Event.
+func (e RawEvent) String() string {
+	return fmt.Sprintf("RawEvent{DeviceID: %d, Time: %d, Detail: %d}",
+		e.DeviceID, e.Time, e.Detail)
+}
+
+// TouchEvent covers TouchBegin, TouchUpdate and TouchEnd.
+type TouchEvent struct {
+	DeviceID int
+	Time     xproto.Timestamp
+	TouchID  int
+	Root     xproto.Window
+	Event    xproto.Window
+	Child    xproto.Window
+	RootX    float64
+	RootY    float64
+
+	buf []byte
+}
+
+// Bytes satisfies xgb.Event, returning the raw XGE payload this event was
+// decoded from.
+func (e TouchEvent) Bytes() []byte { return e.buf }
+
+// String satisfies xgb.Event.
+func (e TouchEvent) String() string {
+	return fmt.Sprintf("TouchEvent{DeviceID: %d, Time: %d, TouchID: %d, "+
+		"Root: %d, Event: %d, Child: %d, RootX: %f, RootY: %f}",
+		e.DeviceID, e.Time, e.TouchID, e.Root, e.Event, e.Child,
+		e.RootX, e.RootY)
+}
+
+// RawMotionFun, RawKeyPressFun, and TouchFun are the callback function
+// types for this package's events. Their Connect methods each take a
+// different set of arguments for their own ergonomic public API (no
+// window at all, or an extra evtype to pick among TouchBegin/Update/End),
+// so only their Run method needs to satisfy xevent.ExtensionCallback.
+type RawMotionFun func(xu *xgbutil.XUtil, e RawEvent)
+type RawKeyPressFun func(xu *xgbutil.XUtil, e RawEvent)
+type TouchFun func(xu *xgbutil.XUtil, e TouchEvent)
+
+func (cb RawMotionFun) Connect(xu *xgbutil.XUtil) {
+	xevent.ConnectExtension(xu, RawMotion, xevent.NoWindow, cb)
+}
+func (cb RawMotionFun) Run(xu *xgbutil.XUtil, ev interface{}) {
+	cb(xu, ev.(RawEvent))
+}
+
+func (cb RawKeyPressFun) Connect(xu *xgbutil.XUtil) {
+	xevent.ConnectExtension(xu, RawKeyPress, xevent.NoWindow, cb)
+}
+func (cb RawKeyPressFun) Run(xu *xgbutil.XUtil, ev interface{}) {
+	cb(xu, ev.(RawEvent))
+}
+
+// Connect registers 'cb' for one of TouchBegin, TouchUpdate or TouchEnd,
+// as picked out by 'evtype'.
+func (cb TouchFun) Connect(xu *xgbutil.XUtil, win xproto.Window, evtype int) {
+	xevent.ConnectExtension(xu, evtype, win, cb)
+}
+func (cb TouchFun) Run(xu *xgbutil.XUtil, ev interface{}) {
+	cb(xu, ev.(TouchEvent))
+}
+
+// Init queries XInput2's extension opcode and registers this package's
+// events with xevent. It must be called after a successful XInput2
+// QueryVersion handshake and before xevent.Main is started.
+func Init(xu *xgbutil.XUtil) error {
+	reply, err := xproto.QueryExtension(xu.Conn(),
+		uint16(len("XInputExtension")), "XInputExtension").Reply()
+	if err != nil {
+		return err
+	}
+	major = reply.MajorOpcode
+
+	RawMotion = xevent.GenericEvtype(major, xiRawMotion)
+	RawKeyPress = xevent.GenericEvtype(major, xiRawKeyPress)
+	TouchBegin = xevent.GenericEvtype(major, xiTouchBegin)
+	TouchUpdate = xevent.GenericEvtype(major, xiTouchUpdate)
+	TouchEnd = xevent.GenericEvtype(major, xiTouchEnd)
+
+	xevent.RegisterGenericEvent(major, xiRawMotion, decodeRaw, noTarget)
+	xevent.RegisterGenericEvent(major, xiRawKeyPress, decodeRaw, noTarget)
+	xevent.RegisterGenericEvent(major, xiTouchBegin, decodeTouch, touchTarget)
+	xevent.RegisterGenericEvent(major, xiTouchUpdate, decodeTouch, touchTarget)
+	xevent.RegisterGenericEvent(major, xiTouchEnd, decodeTouch, touchTarget)
+	return nil
+}
+
+// noTarget is used for events with no natural window, like raw input --
+// they're always delivered to xevent.NoWindow, same as core's
+// KeymapNotify.
+func noTarget(ev xgb.Event) xproto.Window { return xevent.NoWindow }
+
+func touchTarget(ev xgb.Event) xproto.Window {
+	return ev.(TouchEvent).Event
+}
+
+// decodeRaw parses the fixed-size header shared by RawMotion and
+// RawKeyPress/RawButtonPress. It doesn't attempt to decode the trailing
+// valuator mask and axis values, since most consumers only need to know
+// that motion happened and on which device.
+func decodeRaw(buf []byte) xgb.Event {
+	return RawEvent{
+		DeviceID: int(binary.LittleEndian.Uint16(buf[10:12])),
+		Time: xproto.Timestamp(
+			binary.LittleEndian.Uint32(buf[12:16])),
+		Detail: int(binary.LittleEndian.Uint32(buf[16:20])),
+		buf:    buf,
+	}
+}
+
+// decodeTouch parses the fixed-size header shared by TouchBegin,
+// TouchUpdate and TouchEnd.
+func decodeTouch(buf []byte) xgb.Event {
+	return TouchEvent{
+		DeviceID: int(binary.LittleEndian.Uint16(buf[10:12])),
+		Time: xproto.Timestamp(
+			binary.LittleEndian.Uint32(buf[12:16])),
+		TouchID: int(binary.LittleEndian.Uint32(buf[16:20])),
+		Root:    xproto.Window(binary.LittleEndian.Uint32(buf[20:24])),
+		Event:   xproto.Window(binary.LittleEndian.Uint32(buf[24:28])),
+		Child:   xproto.Window(binary.LittleEndian.Uint32(buf[28:32])),
+		RootX:   fp1616(binary.LittleEndian.Uint32(buf[32:36])),
+		RootY:   fp1616(binary.LittleEndian.Uint32(buf[36:40])),
+		buf:     buf,
+	}
+}
+
+// fp1616 converts an XInput2 FP1616 fixed-point value (16.16) to a float64.
+func fp1616(v uint32) float64 {
+	return float64(int32(v)) / 65536.0
+}